@@ -4,28 +4,15 @@ import (
 	"backend/dfs"
 	"backend/utils"
 	"errors"
-	"fmt"
+	"io"
 	"sort"
 )
 
-
+// writeAll pushes content to fd starting at off through uploadPipeline, which fans it out as
+// dfs.MaxChunkSize-aligned pieces across a bounded worker pool instead of writing it as one
+// tight synchronous dfs.Write loop.
 func writeAll(fd int, off int64, content string) (err error) {
-	toWrite := int64(len(content))
-	for toWrite > 0 {
-		n, err := dfs.Write(fd, off, content[:toWrite])
-		if err != nil {
-			return err
-		}
-		toWrite = toWrite - n
-		off = off + n
-	}
-	
-	if toWrite != 0 {
-		return fmt.Errorf("expect to write %d bytes, actually it is %d", len(content),
-			int64(len(content)) - toWrite)
-	}
-
-	return nil
+	return uploadPipeline(fd, off, content)
 }
 
 func FileCreate(path string, initSize int64) (err error) {
@@ -42,11 +29,12 @@ func FileCreate(path string, initSize int64) (err error) {
 	}
 
 	err = dfs.Close(fd)
+	openCache.invalidatePath(path)
 	return err
 }
 
 func FileGetAll(path string) (content string, err error) {
-	fileInfo, err := dfs.Stat(path)
+	fileInfo, err := openCache.statOrFetch(path)
 	if err != nil {
 		return "", err
 	}
@@ -62,7 +50,7 @@ func FileGetAll(path string) (content string, err error) {
 }
 
 func FileAppend(path string, content string) (err error) {
-	fileInfo, err := dfs.Stat(path)
+	fileInfo, err := openCache.statOrFetch(path)
 	if err != nil {
 		return err
 	}
@@ -83,11 +71,12 @@ func FileAppend(path string, content string) (err error) {
 	}
 
 	err = dfs.Close(fd)
+	openCache.invalidatePath(path)
 	return err
 }
 
 func FileOverwriteAll(path string, content string) error {
-	fileInfo, err := dfs.Stat(path)
+	fileInfo, err := openCache.statOrFetch(path)
 	if err != nil {
 		return err
 	}
@@ -115,13 +104,45 @@ func FileOverwriteAll(path string, content string) error {
 	}
 
 	err = dfs.Close(fd)
+	openCache.invalidatePath(path)
 	return err
 }
 
+// FileOverwriteAllStream is the streaming counterpart of FileOverwriteAll: it drains r through
+// dfs.WriteStream chunk by chunk instead of requiring the caller to hold the whole file as a Go
+// string, which matters for large content like sheet checkpoints.
+func FileOverwriteAllStream(path string, r io.Reader, size int64) error {
+	fileInfo, err := openCache.statOrFetch(path)
+	if err != nil {
+		return err
+	}
 
+	if fileInfo.IsDir {
+		return errors.New("cannot write a directory")
+	}
+
+	fd, err := dfs.Open(path)
+	if err != nil {
+		return err
+	}
+
+	if fileInfo.Size > size {
+		if err := dfs.Truncate(fd, size); err != nil {
+			return err
+		}
+	}
+
+	if _, err := streamPipeline(fd, 0, r); err != nil {
+		return err
+	}
+
+	err = dfs.Close(fd)
+	openCache.invalidatePath(path)
+	return err
+}
 
 func DirFileNamesAll(path string) (filenames []string, err error) {
-	fileInfos, err := dfs.Scan(path)
+	fileInfos, err := openCache.scanOrFetch(path)
 	if err != nil {
 		return nil, err
 	}
@@ -206,4 +227,4 @@ func DirFilenamesAllSorted(path string) (filenames []string, err error) {
 //	err = writeAll(fd, off, block[:toWrite])
 //
 //	return err
-//}
\ No newline at end of file
+//}
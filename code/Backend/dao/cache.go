@@ -0,0 +1,224 @@
+package dao
+
+import (
+	"DFS/fsck"
+	"DFS/util"
+	"backend/dfs"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// attrCache memoizes dfs.Stat and dfs.Scan results for a short TTL so that
+// hot paths (e.g. service.sheetGetCheckPointNum, which does a full
+// DirFilenamesAllSorted on nearly every log append) don't re-issue a metadata
+// RPC to the master on every call. A TTL of 0 disables caching entirely.
+type attrCache struct {
+	mu  sync.RWMutex
+	ttl time.Duration
+
+	stats map[string]statEntry
+	scans map[string]scanEntry
+
+	hits   uint64
+	misses uint64
+}
+
+type statEntry struct {
+	info    dfs.FileInfo
+	expires time.Time
+}
+
+type scanEntry struct {
+	infos   []dfs.FileInfo
+	expires time.Time
+}
+
+var openCache = &attrCache{
+	stats: make(map[string]statEntry),
+	scans: make(map[string]scanEntry),
+}
+
+// SetOpenCache sets the TTL used to memoize dfs.Stat/dfs.Scan results.
+// Passing 0 disables the cache and every lookup falls through to dfs.
+func SetOpenCache(ttl time.Duration) {
+	openCache.mu.Lock()
+	defer openCache.mu.Unlock()
+	openCache.ttl = ttl
+	openCache.stats = make(map[string]statEntry)
+	openCache.scans = make(map[string]scanEntry)
+	atomic.StoreUint64(&openCache.hits, 0)
+	atomic.StoreUint64(&openCache.misses, 0)
+}
+
+// CacheStats reports the attribute cache's hit/miss counts since the last
+// SetOpenCache call.
+func CacheStats() (hits, misses uint64) {
+	return atomic.LoadUint64(&openCache.hits), atomic.LoadUint64(&openCache.misses)
+}
+
+func (c *attrCache) statOrFetch(path string) (dfs.FileInfo, error) {
+	if c.ttl == 0 {
+		return dfs.Stat(path)
+	}
+
+	c.mu.RLock()
+	entry, ok := c.stats[path]
+	c.mu.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		atomic.AddUint64(&c.hits, 1)
+		return entry.info, nil
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+	info, err := dfs.Stat(path)
+	if err != nil {
+		return info, err
+	}
+
+	c.mu.Lock()
+	c.stats[path] = statEntry{info: info, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return info, nil
+}
+
+func (c *attrCache) scanOrFetch(path string) ([]dfs.FileInfo, error) {
+	if c.ttl == 0 {
+		return dfs.Scan(path)
+	}
+
+	c.mu.RLock()
+	entry, ok := c.scans[path]
+	c.mu.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		atomic.AddUint64(&c.hits, 1)
+		return entry.infos, nil
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+	infos, err := dfs.Scan(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.scans[path] = scanEntry{infos: infos, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return infos, nil
+}
+
+// invalidatePath drops any cached Stat for path and any cached Scan for path or
+// its parent directory. FileCreate, FileAppend, FileOverwriteAll,
+// FileOverwriteAllStream and RepairMissingChunks call it after changing path;
+// other mutating calls such as dao.Remove and dao.DirCreate do not call it
+// themselves (see InvalidatePath).
+func (c *attrCache) invalidatePath(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.stats, path)
+	delete(c.scans, path)
+	delete(c.scans, parentDir(path))
+}
+
+// InvalidatePath is the exported form of invalidatePath, for callers that delete or otherwise
+// mutate a path through a dao call that predates OpenCache and doesn't invalidate it itself (dao.
+// Remove, used directly by service.truncateFrom's crash-recovery cleanup).
+func InvalidatePath(path string) {
+	openCache.invalidatePath(path)
+}
+
+var (
+	fsckMasterAddr   string
+	fsckChunkServers []string
+)
+
+// SetFsckEndpoints configures where RepairMissingChunks looks for the master and chunkservers it
+// needs to run a targeted DFS/fsck check. Must be called once at startup, alongside SetOpenCache;
+// RepairMissingChunks returns an error until it is.
+func SetFsckEndpoints(masterAddr string, chunkServers []string) {
+	fsckMasterAddr = masterAddr
+	fsckChunkServers = chunkServers
+}
+
+// RepairMissingChunks runs a targeted DFS/fsck check (see fsck.RepairPath) scoped to path,
+// invalidating the cached attributes for path so the next Stat/Scan reflects whatever the check
+// found. It is used by service.SheetFSCheck so a sheet log/checkpoint that merely failed to read
+// transiently doesn't get reported as unrecoverable before fsck gets a chance to confirm or deny
+// that its chunk is actually gone.
+func RepairMissingChunks(path string) error {
+	if fsckMasterAddr == "" {
+		return fmt.Errorf("dao: RepairMissingChunks called before SetFsckEndpoints")
+	}
+
+	chunkServers := make([]util.Address, len(fsckChunkServers))
+	for i, addr := range fsckChunkServers {
+		chunkServers[i] = util.Address(addr)
+	}
+
+	if err := fsck.RepairPath(util.Address(fsckMasterAddr), chunkServers, util.DFSPath(path)); err != nil {
+		return err
+	}
+
+	openCache.invalidatePath(path)
+	return nil
+}
+
+var (
+	ecMasterAddr   string
+	ecParams       util.ECParams
+	ecShardServers []string
+)
+
+// SetErasureCodingEndpoints configures MarkPathReadOnlyForErasureCoding to ask the master which
+// chunkserver holds a path's first chunk and tell it to erasure-code that chunk across
+// shardServers using the given Reed-Solomon layout. Must be called once at startup, alongside
+// SetFsckEndpoints; until it is, MarkPathReadOnlyForErasureCoding is a no-op, so erasure coding
+// stays opt-in for deployments that haven't provisioned shard-holding chunkservers.
+func SetErasureCodingEndpoints(masterAddr string, ec util.ECParams, shardServers []string) {
+	ecMasterAddr = masterAddr
+	ecParams = ec
+	ecShardServers = shardServers
+}
+
+// MarkPathReadOnlyForErasureCoding asks path's first chunk's primary chunkserver to register that
+// chunk for background erasure coding (see chunkserver.EncodeChunkToShards), once the data backing
+// path is never going to change again. service.sheetCreatePickledCheckPointInDfs calls this right
+// after writing out a new checkpoint, since a checkpoint file is never modified after creation. A
+// failure here only means the chunk stays a full replica instead of shrinking to K+M shards; it
+// never affects correctness, so callers are expected to log and continue rather than fail on it.
+func MarkPathReadOnlyForErasureCoding(path string) error {
+	if ecMasterAddr == "" {
+		return nil
+	}
+
+	var replicas util.GetReplicasRet
+	getArgs := util.GetReplicasArg{Path: util.DFSPath(path), ChunkIndex: 0}
+	if err := util.Call(ecMasterAddr, "Master.GetReplicasRPC", getArgs, &replicas); err != nil {
+		return err
+	}
+	if len(replicas.ChunkServerAddrs) == 0 {
+		return fmt.Errorf("dao: no chunkserver holds the first chunk of %s", path)
+	}
+
+	shardAddrs := make([]util.Address, len(ecShardServers))
+	for i, addr := range ecShardServers {
+		shardAddrs[i] = util.Address(addr)
+	}
+
+	markArgs := util.MarkReadOnlyArgs{Handle: replicas.ChunkHandle, EC: ecParams, ShardAddrs: shardAddrs}
+	var markReply util.MarkReadOnlyReply
+	return util.Call(string(replicas.ChunkServerAddrs[0]), "ChunkServer.MarkReadOnlyRPC", markArgs, &markReply)
+}
+
+func parentDir(path string) string {
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == '/' {
+			if i == 0 {
+				return "/"
+			}
+			return path[:i]
+		}
+	}
+	return path
+}
@@ -0,0 +1,132 @@
+package dao
+
+import (
+	"backend/dfs"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultUploadWorkers = 4
+	maxWriteRetries      = 3
+	retryBaseDelay       = 50 * time.Millisecond
+)
+
+var uploadWorkers = defaultUploadWorkers
+
+// SetUploadWorkers bounds how many dfs.MaxChunkSize-aligned pieces of a single writeAll call may
+// be in flight to chunkservers at once. Default is 4.
+func SetUploadWorkers(n int) {
+	if n > 0 {
+		uploadWorkers = n
+	}
+}
+
+// uploadPiece is one dfs.MaxChunkSize-aligned slice of a larger write, tagged with its sequence
+// number (its position within the write). The sequence number only identifies a failed piece in
+// uploadPipeline's error; pieces are written concurrently and may complete in any order.
+type uploadPiece struct {
+	seq     int
+	off     int64
+	content string
+}
+
+// uploadPipeline partitions content into chunk-aligned pieces and pushes them through
+// writePieceWithRetry (retrying transient per-piece failures with exponential backoff) across a
+// bounded worker pool (see SetUploadWorkers), genuinely N in flight at once: pieces are
+// chunk-aligned and so never overlap in offset, meaning they land on distinct chunks and are safe
+// to write concurrently. Once any piece exhausts its retries and permanently fails, no further
+// piece is dispatched -- in-flight pieces are left to finish (there's no cheap way to cancel a
+// dfs.Write already underway), but nothing new starts, matching writeAll's old stop-at-first-
+// failure behavior instead of writing a file full of holes around the failed range.
+func uploadPipeline(fd int, off int64, content string) error {
+	pieces := splitIntoPieces(off, content)
+	if len(pieces) == 0 {
+		return nil
+	}
+
+	results := make([]error, len(pieces))
+	sem := make(chan struct{}, uploadWorkers)
+	var wg sync.WaitGroup
+	var failed atomic.Bool
+
+	for i, piece := range pieces {
+		sem <- struct{}{}
+		if failed.Load() {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(i int, piece uploadPiece) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := writePieceWithRetry(fd, piece); err != nil {
+				results[i] = err
+				failed.Store(true)
+			}
+		}(i, piece)
+	}
+	wg.Wait()
+
+	for i, err := range results {
+		if err != nil {
+			return fmt.Errorf("upload piece seq=%d off=%d failed after retries: %w", pieces[i].seq, pieces[i].off, err)
+		}
+	}
+	return nil
+}
+
+func splitIntoPieces(off int64, content string) []uploadPiece {
+	chunkSize := int64(dfs.MaxChunkSize)
+	var pieces []uploadPiece
+
+	// Each piece ends at the next chunk boundary of the file, so an unaligned off yields a short
+	// first piece rather than pieces that straddle two chunks.
+	for start, seq := int64(0), 0; start < int64(len(content)); seq++ {
+		end := start + chunkSize - (off+start)%chunkSize
+		if end > int64(len(content)) {
+			end = int64(len(content))
+		}
+		pieces = append(pieces, uploadPiece{seq: seq, off: off + start, content: content[start:end]})
+		start = end
+	}
+	return pieces
+}
+
+func writePieceWithRetry(fd int, piece uploadPiece) error {
+	toWrite := piece.content
+	off := piece.off
+
+	var lastErr error
+	for attempt := 0; attempt < maxWriteRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(retryBaseDelay << (attempt - 1))
+		}
+
+		remaining := toWrite
+		curOff := off
+		for len(remaining) > 0 {
+			n, err := dfs.Write(fd, curOff, remaining)
+			if err != nil {
+				lastErr = err
+				break
+			}
+			remaining = remaining[n:]
+			curOff += n
+		}
+		if len(remaining) == 0 {
+			return nil
+		}
+	}
+	return lastErr
+}
+
+// streamPipeline drains r through dfs.WriteStream chunk by chunk so large payloads (e.g. sheet
+// checkpoints) never need to be buffered in full as a Go string, unlike writeAll.
+func streamPipeline(fd int, off int64, r io.Reader) (int64, error) {
+	return dfs.WriteStream(fd, off, r)
+}
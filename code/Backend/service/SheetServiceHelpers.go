@@ -30,101 +30,314 @@ var (
 )
 
 // SheetFSCheck checks the consistency of sheet filesystem (fullChk: THOROUGHLY, !fullChk: BRIEFLY)
-//   and make best efforts to recover it.
+//
+//	and make best efforts to recover it.
+//
 // A file used to be handled by a crashed server should be checked THOROUGHLY, otherwise use SheetBriefFSCheck instead.
 // If the sheet filesystem is consistent, which means -- (lid == cid + 1) && (log end with commit entry),
-//   current maximum cid and lid are returned.
-// Or if the sheet filesystem is inconsistent and cannot not be recovered, error SheetFSUnrecoverableErr is returned.
+//
+//	current maximum cid and lid are returned.
+//
+// Recovery mirrors how a WAL-based store (e.g. LevelDB/Pebble) recovers after a crash: an
+//
+//	uncommitted tail log is replayed into a fresh checkpoint and then committed, while a hole or
+//	an irrecoverably corrupt entry anywhere earlier causes everything after it to be discarded.
+//
+// Every recovery step is idempotent (safe to run twice) and touches the filesystem only, so
+//
+//	SheetFSUnrecoverableErr is now reserved for cases recovery itself fails on.
 func SheetFSCheck(fid uint, fullChk bool) (cid uint, lid uint, err error) {
-	logRoot := gdocFS.GetLogRootPath("sheet", fid)
-	chkpRoot := gdocFS.GetCheckPointRootPath("sheet", fid)
+	expectLid, err := checkAndRecoverLogs(fid, fullChk)
+	if err != nil {
+		return 0, 0, err
+	}
 
-	// check log-only consistency
-	logFileNames, err := dao.DirFilenamesAllSorted(logRoot)
+	expectCid, err := checkAndRecoverCheckPoints(fid, fullChk)
 	if err != nil {
 		return 0, 0, err
 	}
 
-	expectLid := uint(len(logFileNames))
+	// check consistency between log and checkpoint
+	if expectCid+1 != expectLid {
+		if expectCid == expectLid {
+			// Checkpoint cid is exactly one ahead of the logs: the tail commit wrote the
+			// checkpoint and appended the log's commit entry, but a crash landed before the
+			// next empty log file got created (see recoverUncommittedTailLog). The checkpoint
+			// is good; just create the log recovery failed to, instead of discarding it.
+			logger.Errorf("[fid=%d] log lid=%d missing after checkpoint cid=%d commit, recreating it", fid, expectLid+1, expectCid)
+			if err := sheetCreateLogFile(fid, expectLid+1); err != nil {
+				return 0, 0, SheetFSUnrecoverableErr
+			}
+			expectLid += 1
+		} else if expectLid > expectCid+1 {
+			logger.Errorf("[fid=%d] cid(%d)+1 != lid(%d), truncating the longer side", fid, expectCid, expectLid)
+			for l := expectCid + 2; l <= expectLid; l += 1 {
+				if err := sheetDeleteLogFile(fid, l); err != nil {
+					return 0, 0, SheetFSUnrecoverableErr
+				}
+			}
+			expectLid = expectCid + 1
+		} else {
+			logger.Errorf("[fid=%d] cid(%d)+1 != lid(%d), truncating the longer side", fid, expectCid, expectLid)
+			for c := expectLid; c <= expectCid; c += 1 {
+				if err := sheetDeleteCheckPointFile(fid, c); err != nil {
+					return 0, 0, SheetFSUnrecoverableErr
+				}
+			}
+			expectCid = expectLid - 1
+		}
+	}
+
+	return expectCid, expectLid, nil
+}
+
+// checkAndRecoverLogs walks every log file in order, recovering or truncating as needed, and
+// returns the id of the latest log that can be trusted.
+func checkAndRecoverLogs(fid uint, fullChk bool) (expectLid uint, err error) {
+	logRoot := gdocFS.GetLogRootPath("sheet", fid)
+	logFileNames, err := dao.DirFilenamesAllSorted(logRoot)
+	if err != nil {
+		return 0, err
+	}
+	expectLid = uint(len(logFileNames))
+
 	for expect, actual := range logFileNames {
 		curLid := uint(expect + 1)
 		// check name == curLid without holes
 		if strconv.Itoa(int(curLid)) != actual {
-			// TODO: recover - hole in log files
-			return 0, 0, SheetFSUnrecoverableErr
+			logger.Errorf("[fid=%d] hole in log files before lid=%d, truncating tail", fid, curLid)
+			if err := truncateFrom(logRoot, logFileNames[expect:]); err != nil {
+				return 0, SheetFSUnrecoverableErr
+			}
+			return curLid - 1, nil
 		}
 
-		if fullChk {	// fullChk: check log is valid and committed
-			if logs, err := sheetGetPickledLogFromDfs(fid, curLid); err != nil {
-				// TODO: recover - log is invalid
-				return 0, 0, SheetFSUnrecoverableErr
-			} else if lastLog := logs[len(logs)-1]; lastLog != logCommitEntry {
-				if curLid == expectLid {	// last log uncommitted can be recovered by simply committing it
-					// TODO: !!! recover last uncommitted log !!!
-				} else {					// middle log uncommitted can be recovered?
-					// TODO: recover - log is uncommitted
-					return 0, 0, SheetFSUnrecoverableErr
-				}
+		if !fullChk {
+			continue
+		}
 
-				for _, log := range logs {
-					if log.Lid != curLid || log.Row <= 0 || log.Col <= 0 {
-						// TODO: recover - log is invalid
-						return 0, 0, SheetFSUnrecoverableErr
-					}
+		newLid, recovered, err := checkAndRecoverOneLog(fid, curLid, expectLid, logRoot, logFileNames[expect:])
+		if err != nil {
+			return 0, err
+		}
+		if recovered {
+			return newLid, nil
+		}
+	}
+
+	if !fullChk { // !fullChk: check last log is committed
+		if logs, err := sheetGetPickledLogFromDfs(fid, expectLid); err == nil && len(logs) > 0 {
+			if lastLog := logs[len(logs)-1]; lastLog != logCommitEntry {
+				if err := recoverUncommittedTailLog(fid, expectLid-1, expectLid, logs); err != nil {
+					logger.Errorf("[fid=%d] failed recovering uncommitted tail log lid=%d: %+v", fid, expectLid, err)
+					return 0, SheetFSUnrecoverableErr
 				}
+				return expectLid + 1, nil
+			}
+		}
+	}
+
+	return expectLid, nil
+}
+
+// checkAndRecoverOneLog validates a single log file. recovered is true when the caller should
+// stop walking and use newLid as the trusted tail (either because the tail log was replayed and
+// committed, or because everything from curLid onward was discarded).
+func checkAndRecoverOneLog(fid uint, curLid uint, expectLid uint, logRoot string, remaining []string) (newLid uint, recovered bool, err error) {
+	logs, logErr := sheetGetPickledLogFromDfs(fid, curLid)
+	if logErr != nil {
+		// The log file itself may simply be missing its chunks (a chunkserver crashed
+		// mid-write without re-replicating); try a targeted fsck/repair before giving up.
+		if dao.RepairMissingChunks(gdocFS.GetLogPath("sheet", fid, curLid)) == nil {
+			logs, logErr = sheetGetPickledLogFromDfs(fid, curLid)
+		}
+	}
+	if logErr != nil {
+		logger.Errorf("[fid=%d] log lid=%d is unreadable, truncating tail", fid, curLid)
+		if err := truncateFrom(logRoot, remaining); err != nil {
+			return 0, false, SheetFSUnrecoverableErr
+		}
+		return curLid - 1, true, nil
+	}
+
+	if len(logs) == 0 {
+		// A freshly created, not-yet-written log (the normal state right after a commit) is
+		// trivially consistent: there's nothing yet to replay or validate.
+		return 0, false, nil
+	}
+
+	if lastLog := logs[len(logs)-1]; lastLog != logCommitEntry {
+		if curLid != expectLid { // a middle log being uncommitted makes everything after it unreliable
+			logger.Errorf("[fid=%d] middle log lid=%d is uncommitted, truncating tail", fid, curLid)
+			if err := truncateFrom(logRoot, remaining); err != nil {
+				return 0, false, SheetFSUnrecoverableErr
+			}
+			return curLid - 1, true, nil
+		}
+
+		// tail log uncommitted: replay it into a fresh checkpoint and commit it
+		if err := recoverUncommittedTailLog(fid, curLid-1, curLid, logs); err != nil {
+			logger.Errorf("[fid=%d] failed recovering uncommitted tail log lid=%d: %+v", fid, curLid, err)
+			return 0, false, SheetFSUnrecoverableErr
+		}
+		return curLid + 1, true, nil
+	}
+
+	for _, one := range logs {
+		if one.Lid != curLid || one.Row <= 0 || one.Col <= 0 {
+			if one == logCommitEntry {
+				continue
+			}
+			logger.Errorf("[fid=%d] log lid=%d contains an invalid entry, truncating tail", fid, curLid)
+			if err := truncateFrom(logRoot, remaining); err != nil {
+				return 0, false, SheetFSUnrecoverableErr
 			}
+			return curLid - 1, true, nil
 		}
 	}
-	if !fullChk {	// !fullChk: check last log is committed
-		if logs, err := sheetGetPickledLogFromDfs(fid, expectLid); err != nil {
-			// TODO: recover - log is invalid
-			return 0, 0, SheetFSUnrecoverableErr
-		} else if lastLog := logs[len(logs)-1]; lastLog != logCommitEntry {
-			// TODO: !!! recover last uncommitted log !!!
+
+	return 0, false, nil
+}
+
+// recoverUncommittedTailLog replays every valid entry of an uncommitted tail log into an
+// in-memory sheet based on checkpoint cid, materializes a fresh checkpoint at cid+1, appends a
+// commit entry to the log, and creates the next empty log -- mirroring how LevelDB/Pebble
+// recover the tail of the WAL after a crash.
+//
+// Safe to call twice. This is only ever invoked when the caller has just confirmed (by reading
+// log lid fresh) that it does not yet end with a commit entry, so the append below can never
+// double up. If the cid+1 checkpoint already exists, an earlier attempt got that far before
+// crashing -- replaying and writing it again is skipped -- but the commit-entry append and next
+// log file are still (re-)done unconditionally below, because a crash could just as easily have
+// landed between writing the checkpoint and appending the commit entry: taking the checkpoint's
+// existence alone as "fully recovered" would leave log lid permanently uncommitted.
+func recoverUncommittedTailLog(fid uint, cid uint, lid uint, logs []gdocFS.SheetLogPickle) error {
+	memSheet, err := newRecoverySheet(fid, cid)
+	if err != nil {
+		return err
+	}
+	memSheet.Lock()
+	defer memSheet.Unlock()
+
+	if _, err := sheetGetPickledCheckPointFromDfs(fid, cid+1); err != nil {
+		for _, log := range logs {
+			if log == logCommitEntry || log.Row <= 0 || log.Col <= 0 {
+				continue
+			}
+			memSheet.Set(log.Row, log.Col, log.New)
+		}
+
+		rows, cols := memSheet.Shape()
+		if err := sheetCreatePickledCheckPointInDfs(fid, cid+1, &gdocFS.SheetCheckPointPickle{
+			Cid:       cid + 1,
+			Timestamp: time.Now(),
+			Rows:      rows,
+			Columns:   cols,
+			Content:   memSheet.ToStringSlice(),
+		}); err != nil {
+			return errors.WithStack(err)
 		}
 	}
 
-	// check checkpoint-only consistency
+	// Propagate a failed append instead of assuming it succeeded: if it didn't, lid is still
+	// genuinely uncommitted, and creating lid+1 regardless would make SheetFSCheck's next pass
+	// see lid+1 exist and mistake lid for a truncatable "middle log", destroying the checkpoint
+	// this call just (re-)recovered.
+	if err := appendOneSheetLog(fid, lid, &logCommitEntry); err != nil {
+		return err
+	}
+
+	return sheetCreateLogFile(fid, lid+1)
+}
+
+// newRecoverySheet builds the in-memory sheet recovery should start replaying from: an empty
+// sheet if there's no checkpoint yet, or the latest valid checkpoint's content otherwise.
+func newRecoverySheet(fid uint, baseCid uint) (*cache.MemSheet, error) {
+	if baseCid == 0 {
+		return cache.NewMemSheet(minRows, minCols), nil
+	}
+
+	chkp, err := sheetGetPickledCheckPointFromDfs(fid, baseCid)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return cache.NewMemSheetFromStringSlice(chkp.Content, chkp.Columns), nil
+}
+
+// checkAndRecoverCheckPoints walks every checkpoint file in order, truncating the tail on the
+// first hole or invalid entry, and returns the id of the latest checkpoint that can be trusted.
+func checkAndRecoverCheckPoints(fid uint, fullChk bool) (expectCid uint, err error) {
+	chkpRoot := gdocFS.GetCheckPointRootPath("sheet", fid)
 	chkpFileNames, err := dao.DirFilenamesAllSorted(chkpRoot)
 	if err != nil {
-		return 0, 0, err
+		return 0, err
 	}
+	expectCid = uint(len(chkpFileNames))
 
-	expectCid := uint(len(chkpFileNames))
 	for expect, actual := range chkpFileNames {
 		curCid := uint(expect) + 1
 		// check name == curCid without holes
 		if strconv.Itoa(int(curCid)) != actual {
-			// TODO: recover - hole in checkpoint files
-			return 0, 0, SheetFSUnrecoverableErr
+			logger.Errorf("[fid=%d] hole in checkpoint files before cid=%d, truncating tail", fid, curCid)
+			if err := truncateFrom(chkpRoot, chkpFileNames[expect:]); err != nil {
+				return 0, SheetFSUnrecoverableErr
+			}
+			return curCid - 1, nil
 		}
 
-		if fullChk {	// fullChk: check checkpoint is valid
-			if chkp, err := sheetGetPickledCheckPointFromDfs(fid, curCid); err != nil ||
-				chkp.Cid != curCid || chkp.Rows <= 0 || chkp.Columns <= 0 {
-				// TODO: recover - checkpoint is invalid
-				return 0, 0, SheetFSUnrecoverableErr
+		if !fullChk {
+			continue
+		}
+
+		chkp, chkpErr := sheetGetPickledCheckPointFromDfs(fid, curCid)
+		if chkpErr != nil {
+			if dao.RepairMissingChunks(gdocFS.GetCheckPointPath("sheet", fid, curCid)) == nil {
+				chkp, chkpErr = sheetGetPickledCheckPointFromDfs(fid, curCid)
 			}
 		}
+		if chkpErr != nil || chkp.Cid != curCid || chkp.Rows <= 0 || chkp.Columns <= 0 {
+			// covers an unreadable or corrupt checkpoint; a valid checkpoint newer than any
+			// log passes here and is truncated by SheetFSCheck's cid/lid comparison
+			logger.Errorf("[fid=%d] checkpoint cid=%d is invalid, truncating tail", fid, curCid)
+			if err := truncateFrom(chkpRoot, chkpFileNames[expect:]); err != nil {
+				return 0, SheetFSUnrecoverableErr
+			}
+			return curCid - 1, nil
+		}
 	}
 
-	// check consistency between log and checkpoint
-	if expectCid + 1 != expectLid {
-		// TODO: recover - cid + 1 != lid
-		return 0, 0, SheetFSUnrecoverableErr
-	}
+	return expectCid, nil
+}
 
-	return expectCid, expectLid, nil
+// truncateFrom best-effort deletes every file named in names under root. Logs and checkpoints
+// are strictly ordered, so once the first hole or irrecoverable entry is found, everything from
+// that point on is unreliable and is discarded rather than declaring the whole sheet
+// unrecoverable.
+//
+// dao.Remove predates the attribute cache and doesn't invalidate it itself, so each deletion is
+// followed by dao.InvalidatePath -- otherwise a SheetFSCheck retry within the cache's TTL window
+// could see a stale, pre-deletion DirFilenamesAllSorted result and try to operate on a file that
+// was just removed right here.
+func truncateFrom(root string, names []string) error {
+	for _, name := range names {
+		path := root + "/" + name
+		if err := dao.Remove(path); err != nil {
+			return err
+		}
+		dao.InvalidatePath(path)
+	}
+	return nil
 }
 
-func appendOneSheetLog(fid uint, lid uint, log *gdocFS.SheetLogPickle) {
+func appendOneSheetLog(fid uint, lid uint, log *gdocFS.SheetLogPickle) error {
 	path := gdocFS.GetLogPath("sheet", fid, lid)
 	fileRawByte, _ := json.Marshal(*log)
 	fileRaw := string(fileRawByte)
 	if err := dao.FileAppend(path, fileRaw); err != nil {
 		logger.Errorf("[%s] Log file append fails!\n%+v", path, err)
-		return
+		return errors.WithStack(err)
 	}
+	return nil
 }
 
 func commitOneSheetWithCache(fid uint, memSheet *cache.MemSheet) (cid uint) {
@@ -145,20 +358,22 @@ func commitOneSheetWithCache(fid uint, memSheet *cache.MemSheet) (cid uint) {
 	cid = curCid + 1
 	rows, cols := memSheet.Shape()
 	if err := sheetCreatePickledCheckPointInDfs(fid, cid, &gdocFS.SheetCheckPointPickle{
-		Cid: cid,
+		Cid:       cid,
 		Timestamp: time.Now(),
-		Rows: rows,
-		Columns: cols,
-		Content: memSheet.ToStringSlice(),
+		Rows:      rows,
+		Columns:   cols,
+		Content:   memSheet.ToStringSlice(),
 	}); err != nil {
 		logger.Errorf("%+v", err)
 	}
 
 	// write commit entry to log with lid=curCid+1
-	appendOneSheetLog(fid, lid, &logCommitEntry)
+	if err := appendOneSheetLog(fid, lid, &logCommitEntry); err != nil {
+		logger.Errorf("%+v", err)
+	}
 
 	// create log with lid=curCid+2
-	if err := sheetCreateLogFile(fid, lid + 1); err != nil {
+	if err := sheetCreateLogFile(fid, lid+1); err != nil {
 		logger.Errorf("%+v", err)
 	}
 
@@ -175,9 +390,12 @@ func commitSheetsWithCache(fids []uint, memSheets []*cache.MemSheet) {
 }
 
 // When calling recoverSheetFromLog, log file must end with commit entry because log would be committed automatically
-//   when all users quit editing or sheet is evicted from memCache.
+//
+//	when all users quit editing or sheet is evicted from memCache.
+//
 // BUT log can be *UNCOMMITTED* if the server it belonged to crashed, for which we need to thoroughly handle
-//   all possible circumstances here in order to achieve crash consistency.
+//
+//	all possible circumstances here in order to achieve crash consistency.
 func recoverSheetFromLog(fid uint) (memSheet *cache.MemSheet, inCache bool) {
 	curCid := uint(sheetGetCheckPointNum(fid))
 
@@ -197,11 +415,11 @@ func recoverSheetFromLog(fid uint) (memSheet *cache.MemSheet, inCache bool) {
 	}
 
 	// redo with latest log
-	if logs, err := sheetGetPickledLogFromDfs(fid, curCid + 1); err != nil {
+	if logs, err := sheetGetPickledLogFromDfs(fid, curCid+1); err != nil {
 		logger.Errorf("%+v", err)
 		return nil, false
 	} else {
-		for li := 0; li < len(logs) - 1; li += 1 {	// without logCommitEntry, which is in the end
+		for li := 0; li < len(logs)-1; li += 1 { // without logCommitEntry, which is in the end
 			log := &logs[li]
 			memSheet.Set(log.Row, log.Col, log.New)
 		}
@@ -243,9 +461,19 @@ func sheetCreatePickledCheckPointInDfs(fid uint, cid uint, chkp *gdocFS.SheetChe
 	path := gdocFS.GetCheckPointPath("sheet", fid, cid)
 	if err := dao.FileCreate(path, 0); err != nil {
 		return errors.WithStack(err)
-	} else {
-		return sheetWritePickledCheckPointToDfs(fid, cid, chkp)
+	} else if err := sheetWritePickledCheckPointToDfs(fid, cid, chkp); err != nil {
+		return err
+	}
+
+	// A checkpoint is never modified again once written, so it's a prime candidate for the
+	// background erasure-coding job (chunkserver.EncodeChunkToShards): asking for it here, rather
+	// than not at all, is what actually exercises that job outside of tests. Best-effort only --
+	// a failure here just leaves the checkpoint's chunk as a full replica instead of shrinking it
+	// to K+M shards, so it's logged and swallowed rather than failing the checkpoint commit.
+	if err := dao.MarkPathReadOnlyForErasureCoding(path); err != nil {
+		logger.Errorf("[fid=%d] checkpoint cid=%d failed to register for erasure coding: %+v", fid, cid, err)
 	}
+	return nil
 }
 
 // sheetCreateCheckPointDir create a empty checkpoint directory in dfs with fid
@@ -259,7 +487,7 @@ func sheetCreateCheckPointDir(fid uint) (err error) {
 }
 
 // sheetDeleteCheckPointFile delete a checkpoint file in dfs with fid and cid
-func sheetDeleteCheckPointFile(fid uint, cid uint) (err error)  {
+func sheetDeleteCheckPointFile(fid uint, cid uint) (err error) {
 	chkpPath := gdocFS.GetCheckPointPath("sheet", fid, cid)
 	if err := dao.Remove(chkpPath); err != nil {
 		return err
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"backend/dfs"
+	"backend/lib/gdocFS"
+	"backend/utils"
+	"github.com/pkg/errors"
+)
+
+// SheetSnapshot creates a copy-on-write clone of sheet fid's checkpoint+log tree at the current
+// commit boundary, without physically copying any chunk data, and returns a new fid usable for
+// read-only browsing or as a fork base -- e.g. "restore to yesterday", or cheap A/B editing of a
+// large sheet.
+func SheetSnapshot(fid uint) (snapFid uint, err error) {
+	if memSheet, inCache := getSheetCache().Get(fid); inCache {
+		commitOneSheetWithCache(fid, memSheet)
+	}
+
+	snapFid = utils.NewFid()
+
+	srcLogRoot := gdocFS.GetLogRootPath("sheet", fid)
+	dstLogRoot := gdocFS.GetLogRootPath("sheet", snapFid)
+	if err := dfs.Snapshot(srcLogRoot, dstLogRoot); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	srcChkpRoot := gdocFS.GetCheckPointRootPath("sheet", fid)
+	dstChkpRoot := gdocFS.GetCheckPointRootPath("sheet", snapFid)
+	if err := dfs.Snapshot(srcChkpRoot, dstChkpRoot); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return snapFid, nil
+}
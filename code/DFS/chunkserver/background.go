@@ -0,0 +1,88 @@
+package chunkserver
+
+import (
+	"DFS/util"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// ecJob is what RegisterForErasureCoding records about a chunk, so the background loop started
+// by StartRPCServer knows where to put its shards once the chunk goes read-only.
+type ecJob struct {
+	ec         util.ECParams
+	shardAddrs []util.Address
+}
+
+const (
+	// ecScanInterval is how often the background loop looks for chunks ready to encode.
+	ecScanInterval = 30 * time.Second
+	// ecReadOnlyGrace is the quiet period (no writes observed via mtime) after which a registered
+	// chunk is treated as read-only. This snapshot has no explicit commit signal from the master,
+	// so mtime is the best read-only heuristic available.
+	ecReadOnlyGrace = 10 * time.Second
+)
+
+var (
+	ecJobsMu sync.Mutex
+	ecJobs   = make(map[util.Handle]ecJob)
+)
+
+// RegisterForErasureCoding records that handle should be split into ec.K+ec.M shards across
+// shardAddrs once the background encoding loop (see runErasureCodingLoop) observes it's gone
+// quiet. CreateChunkRPC calls this for a chunk created with Encoding == ErasureCoded and exactly
+// EC.K+EC.M ShardAddrs; MarkReadOnlyRPC calls it for a chunk that goes read-only later.
+func (cs *ChunkServer) RegisterForErasureCoding(handle util.Handle, ec util.ECParams, shardAddrs []util.Address) {
+	ecJobsMu.Lock()
+	defer ecJobsMu.Unlock()
+	ecJobs[handle] = ecJob{ec: ec, shardAddrs: shardAddrs}
+}
+
+// runErasureCodingLoop is the background job on the primary chunkserver chunk0-1 asked for: it
+// periodically scans chunks registered via RegisterForErasureCoding and, once a chunk's full
+// replica file hasn't been written to for ecReadOnlyGrace, encodes it into shards via
+// EncodeChunkToShards and drops it from the registry. Started from StartRPCServer.
+func (cs *ChunkServer) runErasureCodingLoop() {
+	ticker := time.NewTicker(ecScanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cs.shutdown:
+			return
+		case <-ticker.C:
+			cs.encodeReadyChunks()
+		}
+	}
+}
+
+func (cs *ChunkServer) encodeReadyChunks() {
+	ecJobsMu.Lock()
+	due := make(map[util.Handle]ecJob, len(ecJobs))
+	for handle, job := range ecJobs {
+		due[handle] = job
+	}
+	ecJobsMu.Unlock()
+
+	for handle, job := range due {
+		info, err := os.Stat(cs.GetFileName(handle))
+		if err != nil {
+			// Already encoded (EncodeChunkToShards removes the full replica) or not written
+			// yet; either way there's nothing for this pass to do.
+			continue
+		}
+		if time.Since(info.ModTime()) < ecReadOnlyGrace {
+			continue
+		}
+
+		if err := cs.EncodeChunkToShards(handle, job.shardAddrs, job.ec); err != nil {
+			log.Printf("chunkserver: background erasure coding of chunk %d failed: %v\n", handle, err)
+			continue
+		}
+
+		ecJobsMu.Lock()
+		delete(ecJobs, handle)
+		ecJobsMu.Unlock()
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/rpc"
 	"os"
+	"path/filepath"
 )
 
 func (cs *ChunkServer) StartRPCServer() error {
@@ -19,6 +20,8 @@ func (cs *ChunkServer) StartRPCServer() error {
 
 	cs.l = listener
 
+	go cs.runErasureCodingLoop()
+
 	go func() {
 	loop:
 		for {
@@ -60,8 +63,22 @@ func (cs *ChunkServer) ReadChunkRPC(args util.ReadChunkArgs, reply *util.ReadChu
 	buf := make([]byte, args.Len)
 	len, err := cs.GetChunk(args.Handle, args.Off, buf)
 	if err != nil {
-		log.Fatalf("get chunk error\n")
-		return err
+		if args.Encoding != util.ErasureCoded {
+			log.Fatalf("get chunk error\n")
+			return err
+		}
+
+		// Full replica is gone because this chunk was erasure-coded after it
+		// went read-only; reconstruct it transparently from any k surviving shards.
+		reconstructed, rerr := cs.readChunkFromShards(args)
+		if rerr != nil {
+			return rerr
+		}
+
+		// len is shadowed by the local above; copy reports the reconstructed length instead.
+		reply.Len = copy(buf, reconstructed)
+		reply.Buf = buf[:reply.Len]
+		return nil
 	}
 
 	reply.Buf = buf[:len]
@@ -74,14 +91,105 @@ func (cs *ChunkServer) ReadChunkRPC(args util.ReadChunkArgs, reply *util.ReadChu
 	return nil
 }
 
+// readChunkFromShards reconstructs the [Off, Off+Len) range of an erasure-coded
+// chunk by pulling any k surviving shards (local or remote) and inverting the
+// Vandermonde submatrix, then re-deriving the requested byte range.
+func (cs *ChunkServer) readChunkFromShards(args util.ReadChunkArgs) ([]byte, error) {
+	have := make(map[int][]byte)
+
+	// A chunkserver holds at most one shard per handle, at whatever index EncodeChunkToShards
+	// assigned it -- not necessarily 0 (see DeleteChunkRPC) -- so find it by globbing rather than
+	// probing a fixed index.
+	if idx, data, ok := cs.localShard(args.Handle); ok {
+		have[idx] = data
+	}
+
+	for idx, addr := range args.ShardAddrs {
+		if len(have) >= args.EC.K {
+			break
+		}
+		if _, ok := have[idx]; ok || addr == "" {
+			continue
+		}
+		var shardReply util.StoreShardArgs
+		fetchArgs := util.StoreShardArgs{Handle: args.Handle, ShardIdx: idx, EC: args.EC}
+		if err := util.Call(string(addr), "ChunkServer.FetchShardRPC", fetchArgs, &shardReply); err != nil {
+			continue
+		}
+		have[idx] = shardReply.Data
+	}
+
+	shards, err := reconstructShards(have, args.EC.K, args.EC.M)
+	if err != nil {
+		return nil, err
+	}
+
+	full := make([]byte, 0, args.EC.K*len(shards[0]))
+	for i := 0; i < args.EC.K; i++ {
+		full = append(full, shards[i]...)
+	}
+
+	end := args.Off + args.Len
+	if end > len(full) {
+		end = len(full)
+	}
+	if args.Off > end {
+		return nil, fmt.Errorf("chunkserver: read offset %d past reconstructed chunk len %d", args.Off, len(full))
+	}
+
+	return full[args.Off:end], nil
+}
+
 func (cs *ChunkServer) CreateChunkRPC(args util.CreateChunkArgs, reply *util.CreateChunkReply) error {
 	filename := cs.GetFileName(args.Handle)
 	fd, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0644)
 	defer fd.Close()
-	return err
+	if err != nil {
+		return err
+	}
+
+	if args.Encoding == util.ErasureCoded && len(args.ShardAddrs) == args.EC.K+args.EC.M {
+		cs.RegisterForErasureCoding(args.Handle, args.EC, args.ShardAddrs)
+	}
+
+	return nil
+}
+
+// MarkReadOnlyRPC registers an already-created, ordinarily-replicated chunk for the background
+// erasure-coding job -- the trigger for a chunk that only becomes read-only after the fact (e.g.
+// a sheet checkpoint), as opposed to CreateChunkRPC's up-front registration for a chunk created
+// with Encoding == ErasureCoded from the start.
+func (cs *ChunkServer) MarkReadOnlyRPC(args util.MarkReadOnlyArgs, reply *util.MarkReadOnlyReply) error {
+	if len(args.ShardAddrs) != args.EC.K+args.EC.M {
+		return fmt.Errorf("chunkserver: expected %d shard addrs, got %d", args.EC.K+args.EC.M, len(args.ShardAddrs))
+	}
+	cs.RegisterForErasureCoding(args.Handle, args.EC, args.ShardAddrs)
+	return nil
+}
+
+// DeleteChunkRPC removes a chunk's on-disk data, including any shard left over from erasure
+// coding. Used by dfs.fsck to reclaim orphan chunks. A chunkserver only ever holds at most one
+// shard per handle, at whatever index EncodeChunkToShards assigned it -- not necessarily 0 -- so
+// the shard is found by globbing rather than assuming a contiguous range starting at index 0.
+func (cs *ChunkServer) DeleteChunkRPC(args util.DeleteChunkArgs, reply *util.DeleteChunkReply) error {
+	if err := os.Remove(cs.GetFileName(args.Handle)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	shardFiles, err := filepath.Glob(cs.GetFileName(args.Handle) + ".shard*")
+	if err != nil {
+		return err
+	}
+	for _, shardFile := range shardFiles {
+		if err := os.Remove(shardFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
 }
 
 //call by client
 // func (cs *ChunkServer) SyncRPC(args util.SyncArgs, reply *util.SyncReply) error {
 
-// }
\ No newline at end of file
+// }
@@ -0,0 +1,332 @@
+package chunkserver
+
+import (
+	"DFS/util"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// gf256 implements the GF(2^8) field arithmetic (poly 0x11d) needed for
+// Reed-Solomon encode/decode of cold chunks, following the same Vandermonde
+// construction SeaweedFS uses for its erasure-coded volumes.
+var (
+	gfExp [512]byte
+	gfLog [256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < 512; i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfInv(a byte) byte {
+	if a == 0 {
+		panic("chunkserver: gfInv(0)")
+	}
+	return gfExp[255-int(gfLog[a])]
+}
+
+// vandermonde builds a rows x cols Vandermonde-like matrix over GF(256) whose
+// top k rows (k == cols) are the identity, so that multiplying it by the k
+// data shards reproduces the data shards unchanged and produces m parity rows.
+func vandermonde(rows, cols int) [][]byte {
+	m := make([][]byte, rows)
+	for r := 0; r < cols; r++ {
+		m[r] = make([]byte, cols)
+		m[r][r] = 1
+	}
+	for r := cols; r < rows; r++ {
+		m[r] = make([]byte, cols)
+		base := byte(r + 1)
+		p := byte(1)
+		for c := 0; c < cols; c++ {
+			m[r][c] = p
+			p = gfMul(p, base)
+		}
+	}
+	return m
+}
+
+// encodeShards splits data into k equally sized data shards (zero-padded to a
+// multiple of k) and computes m parity shards, returning all k+m shards.
+func encodeShards(data []byte, k, m int) ([][]byte, error) {
+	if k <= 0 || m < 0 {
+		return nil, fmt.Errorf("chunkserver: invalid EC params k=%d m=%d", k, m)
+	}
+
+	shardLen := (len(data) + k - 1) / k
+	if shardLen == 0 {
+		shardLen = 1
+	}
+	padded := make([]byte, shardLen*k)
+	copy(padded, data)
+
+	shards := make([][]byte, k+m)
+	for i := 0; i < k; i++ {
+		shards[i] = padded[i*shardLen : (i+1)*shardLen]
+	}
+
+	gen := vandermonde(k+m, k)
+	for r := k; r < k+m; r++ {
+		parity := make([]byte, shardLen)
+		for c := 0; c < k; c++ {
+			coeff := gen[r][c]
+			if coeff == 0 {
+				continue
+			}
+			for i := 0; i < shardLen; i++ {
+				parity[i] ^= gfMul(coeff, shards[c][i])
+			}
+		}
+		shards[r] = parity
+	}
+
+	return shards, nil
+}
+
+// reconstructShards rebuilds every shard in [0, k) from any k surviving shards
+// (data or parity) by inverting the corresponding k x k Vandermonde submatrix.
+func reconstructShards(have map[int][]byte, k, m int) ([][]byte, error) {
+	if len(have) < k {
+		return nil, fmt.Errorf("chunkserver: need %d surviving shards, have %d", k, len(have))
+	}
+
+	gen := vandermonde(k+m, k)
+
+	rows := make([]int, 0, k)
+	for idx := range have {
+		rows = append(rows, idx)
+		if len(rows) == k {
+			break
+		}
+	}
+
+	sub := make([][]byte, k)
+	var shardLen int
+	for i, idx := range rows {
+		sub[i] = gen[idx]
+		shardLen = len(have[idx])
+	}
+
+	inv, err := invertMatrix(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	dataShards := make([][]byte, k)
+	for r := 0; r < k; r++ {
+		out := make([]byte, shardLen)
+		for c := 0; c < k; c++ {
+			coeff := inv[r][c]
+			if coeff == 0 {
+				continue
+			}
+			src := have[rows[c]]
+			for i := 0; i < shardLen; i++ {
+				out[i] ^= gfMul(coeff, src[i])
+			}
+		}
+		dataShards[r] = out
+	}
+
+	full := make([][]byte, k+m)
+	copy(full, dataShards)
+	gen2 := vandermonde(k+m, k)
+	for r := k; r < k+m; r++ {
+		if shard, ok := have[r]; ok {
+			full[r] = shard
+			continue
+		}
+		parity := make([]byte, shardLen)
+		for c := 0; c < k; c++ {
+			coeff := gen2[r][c]
+			if coeff == 0 {
+				continue
+			}
+			for i := 0; i < shardLen; i++ {
+				parity[i] ^= gfMul(coeff, dataShards[c][i])
+			}
+		}
+		full[r] = parity
+	}
+
+	return full, nil
+}
+
+// invertMatrix inverts a square GF(256) matrix via Gauss-Jordan elimination.
+func invertMatrix(m [][]byte) ([][]byte, error) {
+	n := len(m)
+	aug := make([][]byte, n)
+	for r := 0; r < n; r++ {
+		aug[r] = make([]byte, 2*n)
+		copy(aug[r], m[r])
+		aug[r][n+r] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := -1
+		for r := col; r < n; r++ {
+			if aug[r][col] != 0 {
+				pivot = r
+				break
+			}
+		}
+		if pivot == -1 {
+			return nil, fmt.Errorf("chunkserver: singular matrix, cannot reconstruct shards")
+		}
+		aug[col], aug[pivot] = aug[pivot], aug[col]
+
+		inv := gfInv(aug[col][col])
+		for c := 0; c < 2*n; c++ {
+			aug[col][c] = gfMul(aug[col][c], inv)
+		}
+
+		for r := 0; r < n; r++ {
+			if r == col || aug[r][col] == 0 {
+				continue
+			}
+			factor := aug[r][col]
+			for c := 0; c < 2*n; c++ {
+				aug[r][c] ^= gfMul(factor, aug[col][c])
+			}
+		}
+	}
+
+	result := make([][]byte, n)
+	for r := 0; r < n; r++ {
+		result[r] = aug[r][n:]
+	}
+	return result, nil
+}
+
+// GetShardFileName returns the on-disk path for a single shard of an
+// erasure-coded chunk, mirroring GetFileName's layout for full chunks.
+func (cs *ChunkServer) GetShardFileName(handle util.Handle, shardIdx int) string {
+	return fmt.Sprintf("%s.shard%d", cs.GetFileName(handle), shardIdx)
+}
+
+// localShard finds and reads whatever shard this chunkserver holds for handle, regardless of
+// its index -- a chunkserver only ever holds at most one shard per handle, at whatever index
+// EncodeChunkToShards assigned it, not necessarily 0.
+func (cs *ChunkServer) localShard(handle util.Handle) (shardIdx int, data []byte, ok bool) {
+	matches, err := filepath.Glob(cs.GetFileName(handle) + ".shard*")
+	if err != nil || len(matches) == 0 {
+		return 0, nil, false
+	}
+
+	idx, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(matches[0]), filepath.Base(cs.GetFileName(handle))+".shard"))
+	if err != nil {
+		return 0, nil, false
+	}
+
+	data, err = os.ReadFile(matches[0])
+	if err != nil {
+		return 0, nil, false
+	}
+	return idx, data, true
+}
+
+// StoreShardRPC persists a single data or parity shard for an erasure-coded chunk.
+func (cs *ChunkServer) StoreShardRPC(args util.StoreShardArgs, reply *util.StoreShardReply) error {
+	filename := cs.GetShardFileName(args.Handle, args.ShardIdx)
+	fd, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	_, err = fd.Write(args.Data)
+	return err
+}
+
+// ReconstructShardRPC rebuilds a single missing shard onto this chunkserver by
+// pulling any k surviving shards from SourceAddrs, without materializing the
+// whole chunk.
+func (cs *ChunkServer) ReconstructShardRPC(args util.ReconstructShardArgs, reply *util.ReconstructShardReply) error {
+	have := make(map[int][]byte)
+	for idx, addr := range args.SourceAddrs {
+		if idx == args.ShardIdx || addr == "" {
+			continue
+		}
+		var shardReply util.StoreShardArgs
+		fetchArgs := util.StoreShardArgs{Handle: args.Handle, ShardIdx: idx, EC: args.EC}
+		if err := util.Call(string(addr), "ChunkServer.FetchShardRPC", fetchArgs, &shardReply); err != nil {
+			continue
+		}
+		have[idx] = shardReply.Data
+		if len(have) >= args.EC.K {
+			break
+		}
+	}
+
+	rebuilt, err := reconstructShards(have, args.EC.K, args.EC.M)
+	if err != nil {
+		return err
+	}
+
+	storeArgs := util.StoreShardArgs{Handle: args.Handle, ShardIdx: args.ShardIdx, EC: args.EC, Data: rebuilt[args.ShardIdx]}
+	var storeReply util.StoreShardReply
+	return cs.StoreShardRPC(storeArgs, &storeReply)
+}
+
+// FetchShardRPC returns the raw bytes of a locally stored shard, used by
+// ReconstructShardRPC and ReadChunkRPC to gather surviving shards.
+func (cs *ChunkServer) FetchShardRPC(args util.StoreShardArgs, reply *util.StoreShardArgs) error {
+	data, err := os.ReadFile(cs.GetShardFileName(args.Handle, args.ShardIdx))
+	if err != nil {
+		return err
+	}
+	reply.Data = data
+	return nil
+}
+
+// EncodeChunkToShards runs as a background job once a chunk becomes read-only
+// (e.g. after a sheet checkpoint commit): it splits the full chunk into k data
+// shards + m parity shards, distributes them across distinct chunkservers via
+// StoreShardRPC, and deletes this chunkserver's own full replica once every shard
+// is acknowledged. Full replicas held by other chunkservers are not removed.
+func (cs *ChunkServer) EncodeChunkToShards(handle util.Handle, shardAddrs []util.Address, ec util.ECParams) error {
+	if len(shardAddrs) != ec.K+ec.M {
+		return fmt.Errorf("chunkserver: expected %d shard addrs, got %d", ec.K+ec.M, len(shardAddrs))
+	}
+
+	data, err := os.ReadFile(cs.GetFileName(handle))
+	if err != nil {
+		return err
+	}
+
+	shards, err := encodeShards(data, ec.K, ec.M)
+	if err != nil {
+		return err
+	}
+
+	for idx, addr := range shardAddrs {
+		storeArgs := util.StoreShardArgs{Handle: handle, ShardIdx: idx, EC: ec, Data: shards[idx]}
+		var storeReply util.StoreShardReply
+		if err := util.Call(string(addr), "ChunkServer.StoreShardRPC", storeArgs, &storeReply); err != nil {
+			return fmt.Errorf("chunkserver: failed storing shard %d on %s: %w", idx, addr, err)
+		}
+	}
+
+	return os.Remove(cs.GetFileName(handle))
+}
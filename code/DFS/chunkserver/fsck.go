@@ -0,0 +1,42 @@
+package chunkserver
+
+import (
+	"DFS/util"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ListChunksRPC returns every chunk handle this chunkserver actually has data
+// for on disk (full replicas and shards alike), used by dfs.fsck to build the
+// set of chunks that physically exist (set A), so it can be diffed against
+// the set reachable from the master namespace (set B).
+func (cs *ChunkServer) ListChunksRPC(args util.ListChunksArgs, reply *util.ListChunksRet) error {
+	// GetFileName's own naming scheme isn't visible here, so derive the data
+	// directory from a representative filename rather than duplicating it.
+	dataDir := filepath.Dir(cs.GetFileName(0))
+
+	entries, err := filepath.Glob(filepath.Join(dataDir, "*"))
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[util.Handle]bool)
+	for _, entry := range entries {
+		name := filepath.Base(entry)
+		if idx := strings.Index(name, ".shard"); idx >= 0 {
+			name = name[:idx]
+		}
+		handle, err := strconv.ParseInt(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		seen[util.Handle(handle)] = true
+	}
+
+	reply.Handles = make([]util.Handle, 0, len(seen))
+	for handle := range seen {
+		reply.Handles = append(reply.Handles, handle)
+	}
+	return nil
+}
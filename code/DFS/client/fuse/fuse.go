@@ -0,0 +1,267 @@
+// Package fuse mounts the DFS namespace at a local path as a POSIX filesystem,
+// translating VFS calls directly into the existing master and chunkserver RPCs
+// so that tools which cannot speak the backend/dao API can still read and
+// write DFS files.
+package fuse
+
+import (
+	"DFS/util"
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	bazilfuse "bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// Options configures a single mount.
+type Options struct {
+	MasterAddr util.Address
+	ReadOnly   bool
+	ChunkSize  int64 // defaults to util.MAXCHUNKSIZE
+	ReplicaNum int   // recorded only; Create does not pass it to the master, which picks the replica count
+}
+
+// FS is the root of a mounted DFS namespace.
+type FS struct {
+	opts     Options
+	pages    *pageCache
+	prefetch *prefetcher
+}
+
+// Mount mounts the DFS namespace reachable through opts.MasterAddr at
+// mountPoint and serves it until the process exits or Unmount is called.
+func Mount(mountPoint string, opts Options) (*bazilfuse.Conn, error) {
+	if opts.ChunkSize == 0 {
+		opts.ChunkSize = util.MAXCHUNKSIZE
+	}
+	if opts.ReplicaNum == 0 {
+		opts.ReplicaNum = 3
+	}
+
+	mountOpts := []bazilfuse.MountOption{bazilfuse.FSName("dfs"), bazilfuse.Subtype("dfsfuse")}
+	if opts.ReadOnly {
+		mountOpts = append(mountOpts, bazilfuse.ReadOnly())
+	}
+
+	conn, err := bazilfuse.Mount(mountPoint, mountOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	dfsFS := &FS{
+		opts:     opts,
+		pages:    newPageCache(opts.ChunkSize),
+		prefetch: newPrefetcher(opts.MasterAddr),
+	}
+
+	go func() {
+		if err := fs.Serve(conn, dfsFS); err != nil {
+			os.Exit(1)
+		}
+	}()
+
+	return conn, nil
+}
+
+func (f *FS) Root() (fs.Node, error) {
+	return &Node{fs: f, path: "/"}, nil
+}
+
+// Node represents a single DFS path (file or directory) in the mounted tree.
+type Node struct {
+	fs   *FS
+	path string
+
+	mu     sync.Mutex
+	handle int // not set by any operation here; reads and writes are addressed by path
+}
+
+var _ fs.Node = (*Node)(nil)
+var _ fs.NodeStringLookuper = (*Node)(nil)
+var _ fs.HandleReadDirAller = (*Node)(nil)
+var _ fs.NodeOpener = (*Node)(nil)
+var _ fs.NodeCreater = (*Node)(nil)
+var _ fs.NodeMkdirer = (*Node)(nil)
+var _ fs.NodeRemover = (*Node)(nil)
+var _ fs.NodeRenamer = (*Node)(nil)
+var _ fs.HandleReader = (*Node)(nil)
+var _ fs.HandleWriter = (*Node)(nil)
+var _ fs.HandleFlusher = (*Node)(nil)
+var _ fs.HandleReleaser = (*Node)(nil)
+var _ fs.NodeFsyncer = (*Node)(nil)
+
+// Attr implements fs.Node (Getattr).
+func (n *Node) Attr(ctx context.Context, a *bazilfuse.Attr) error {
+	meta, err := getFileMeta(n.fs.opts.MasterAddr, util.DFSPath(n.path))
+	if err != nil {
+		return bazilfuse.ENOENT
+	}
+	if !meta.Exist {
+		return bazilfuse.ENOENT
+	}
+
+	if meta.IsDir {
+		a.Mode = os.ModeDir | 0755
+	} else {
+		a.Mode = 0644
+		a.Size = uint64(meta.Size)
+	}
+	a.Mtime = time.Now()
+	return nil
+}
+
+func (n *Node) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	child := joinPath(n.path, name)
+	meta, err := getFileMeta(n.fs.opts.MasterAddr, util.DFSPath(child))
+	if err != nil || !meta.Exist {
+		return nil, bazilfuse.ENOENT
+	}
+	return &Node{fs: n.fs, path: child}, nil
+}
+
+func (n *Node) ReadDirAll(ctx context.Context) ([]bazilfuse.Dirent, error) {
+	var ret util.ListRet
+	if err := util.Call(string(n.fs.opts.MasterAddr), "Master.ListRPC", util.ListArg{Path: util.DFSPath(n.path)}, &ret); err != nil {
+		return nil, err
+	}
+
+	dirents := make([]bazilfuse.Dirent, 0, len(ret.Files))
+	for _, name := range ret.Files {
+		dirents = append(dirents, bazilfuse.Dirent{Name: name, Type: bazilfuse.DT_Unknown})
+	}
+	return dirents, nil
+}
+
+func (n *Node) Open(ctx context.Context, req *bazilfuse.OpenRequest, resp *bazilfuse.OpenResponse) (fs.Handle, error) {
+	n.fs.prefetch.forget(n.path)
+	return n, nil
+}
+
+func (n *Node) Create(ctx context.Context, req *bazilfuse.CreateRequest, resp *bazilfuse.CreateResponse, respHandle *bazilfuse.Node) (fs.Node, fs.Handle, error) {
+	child := joinPath(n.path, req.Name)
+	if err := util.Call(string(n.fs.opts.MasterAddr), "Master.CreateRPC", util.CreateArg{Path: util.DFSPath(child)}, &util.CreateRet{}); err != nil {
+		return nil, nil, err
+	}
+	node := &Node{fs: n.fs, path: child}
+	return node, node, nil
+}
+
+func (n *Node) Mkdir(ctx context.Context, req *bazilfuse.MkdirRequest) (fs.Node, error) {
+	child := joinPath(n.path, req.Name)
+	if err := util.Call(string(n.fs.opts.MasterAddr), "Master.MkdirRPC", util.MkdirArg{Path: util.DFSPath(child)}, &util.MkdirRet{}); err != nil {
+		return nil, err
+	}
+	return &Node{fs: n.fs, path: child}, nil
+}
+
+func (n *Node) Remove(ctx context.Context, req *bazilfuse.RemoveRequest) error {
+	child := joinPath(n.path, req.Name)
+	return util.Call(string(n.fs.opts.MasterAddr), "Master.DeleteRPC", util.DeleteArg{Path: util.DFSPath(child)}, &util.DeleteRet{})
+}
+
+func (n *Node) Rename(ctx context.Context, req *bazilfuse.RenameRequest, newDir fs.Node) error {
+	// DFS has no native rename RPC; emulate with create-at-destination + delete,
+	// which is sufficient for the common "replace a small metadata file" case.
+	src := joinPath(n.path, req.OldName)
+	dstDir, ok := newDir.(*Node)
+	if !ok {
+		return bazilfuse.EIO
+	}
+	dst := joinPath(dstDir.path, req.NewName)
+
+	content, err := readWholeFile(n.fs.opts.MasterAddr, src)
+	if err != nil {
+		return err
+	}
+	if err := util.Call(string(n.fs.opts.MasterAddr), "Master.CreateRPC", util.CreateArg{Path: util.DFSPath(dst)}, &util.CreateRet{}); err != nil {
+		return err
+	}
+	if err := n.fs.pages.flushAll(n.fs.opts.MasterAddr, util.DFSPath(dst), content); err != nil {
+		return err
+	}
+	return util.Call(string(n.fs.opts.MasterAddr), "Master.DeleteRPC", util.DeleteArg{Path: util.DFSPath(src)}, &util.DeleteRet{})
+}
+
+func (n *Node) Read(ctx context.Context, req *bazilfuse.ReadRequest, resp *bazilfuse.ReadResponse) error {
+	buf, err := n.fs.prefetch.read(n.fs.opts.MasterAddr, util.DFSPath(n.path), int64(req.Offset), req.Size)
+	if err != nil {
+		return err
+	}
+	resp.Data = buf
+	return nil
+}
+
+func (n *Node) Write(ctx context.Context, req *bazilfuse.WriteRequest, resp *bazilfuse.WriteResponse) error {
+	if n.fs.opts.ReadOnly {
+		return bazilfuse.EPERM
+	}
+	if err := n.fs.pages.write(n.fs.opts.MasterAddr, util.DFSPath(n.path), int64(req.Offset), req.Data); err != nil {
+		return err
+	}
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// Flush persists whatever is still staged for this node, so a userspace close(2)/fsync(2) (or
+// the implicit flush most tools issue on exit) doesn't silently drop a partial trailing page.
+func (n *Node) Flush(ctx context.Context, req *bazilfuse.FlushRequest) error {
+	if n.fs.opts.ReadOnly {
+		return nil
+	}
+	return n.fs.pages.flush(n.fs.opts.MasterAddr, util.DFSPath(n.path))
+}
+
+// Release persists whatever is still staged for this node when the last file descriptor onto it
+// is closed, for the same reason as Flush -- some callers only ever trigger Release, not Flush.
+func (n *Node) Release(ctx context.Context, req *bazilfuse.ReleaseRequest) error {
+	if n.fs.opts.ReadOnly {
+		return nil
+	}
+	return n.fs.pages.flush(n.fs.opts.MasterAddr, util.DFSPath(n.path))
+}
+
+// Fsync persists whatever is still staged for this node on an explicit fsync(2).
+func (n *Node) Fsync(ctx context.Context, req *bazilfuse.FsyncRequest) error {
+	if n.fs.opts.ReadOnly {
+		return nil
+	}
+	return n.fs.pages.flush(n.fs.opts.MasterAddr, util.DFSPath(n.path))
+}
+
+func joinPath(dir, name string) string {
+	if dir == "/" {
+		return "/" + name
+	}
+	return dir + "/" + name
+}
+
+func getFileMeta(masterAddr util.Address, path util.DFSPath) (util.GetFileMetaRet, error) {
+	var ret util.GetFileMetaRet
+	err := util.Call(string(masterAddr), "Master.GetFileMetaRPC", util.GetFileMetaArg{Path: path}, &ret)
+	return ret, err
+}
+
+// readWholeFile reads a (small) file in full, used only by Rename's emulation.
+func readWholeFile(masterAddr util.Address, path string) (string, error) {
+	meta, err := getFileMeta(masterAddr, util.DFSPath(path))
+	if err != nil {
+		return "", err
+	}
+
+	var replicas util.GetReplicasRet
+	if err := util.Call(string(masterAddr), "Master.GetReplicasRPC", util.GetReplicasArg{Path: util.DFSPath(path), ChunkIndex: 0}, &replicas); err != nil {
+		return "", err
+	}
+
+	var reply util.ReadChunkReply
+	args := util.ReadChunkArgs{Handle: replicas.ChunkHandle, Off: 0, Len: int(meta.Size), Encoding: replicas.Encoding, EC: replicas.EC, ShardAddrs: replicas.ShardAddrs}
+	if len(replicas.ChunkServerAddrs) == 0 {
+		return "", bazilfuse.ENOENT
+	}
+	if err := util.Call(string(replicas.ChunkServerAddrs[0]), "ChunkServer.ReadChunkRPC", args, &reply); err != nil {
+		return "", err
+	}
+	return string(reply.Buf[:reply.Len]), nil
+}
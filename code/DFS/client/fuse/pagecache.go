@@ -0,0 +1,127 @@
+package fuse
+
+import (
+	"DFS/util"
+	"sync"
+)
+
+// pageCache batches small, possibly out-of-order Write calls per path and
+// flushes them as 64 MB chunk-aligned uploads via LoadDataRPC fan-out once a
+// full chunk's worth of data has accumulated, instead of round-tripping to a
+// chunkserver on every Write.
+type pageCache struct {
+	chunkSize int64
+
+	mu    sync.Mutex
+	pages map[util.DFSPath]*page
+}
+
+type page struct {
+	buf []byte // sparse buffer for the chunk currently being assembled
+	off int64  // DFS offset of buf[0]
+}
+
+func newPageCache(chunkSize int64) *pageCache {
+	return &pageCache{chunkSize: chunkSize, pages: make(map[util.DFSPath]*page)}
+}
+
+// write stages data at off into the in-memory page for path, flushing it through LoadDataRPC as
+// soon as it reaches chunkSize so a long sequential write never buffers more than one chunk at a
+// time. Whatever is left staged afterwards (a partial final page) is only persisted by a later
+// write filling it, or by flush -- see Node.Flush/Release/Fsync, which call flush on every close
+// so a partial page is never silently dropped.
+func (pc *pageCache) write(masterAddr util.Address, path util.DFSPath, off int64, data []byte) error {
+	pc.mu.Lock()
+	p, ok := pc.pages[path]
+	if !ok {
+		p = &page{off: off - off%pc.chunkSize}
+		pc.pages[path] = p
+	}
+
+	rel := int(off - p.off)
+	need := rel + len(data)
+	if need > len(p.buf) {
+		grown := make([]byte, need)
+		copy(grown, p.buf)
+		p.buf = grown
+	}
+	copy(p.buf[rel:], data)
+	full := int64(len(p.buf)) >= pc.chunkSize
+	pc.mu.Unlock()
+
+	if full {
+		return pc.flush(masterAddr, path)
+	}
+	return nil
+}
+
+// flush uploads whatever is currently staged for path via LoadDataRPC fan-out, full chunk or not,
+// and clears the page. write calls this once a page fills up; Node.Flush/Release/Fsync call it to
+// persist a partial page when the file is closed or explicitly synced.
+func (pc *pageCache) flush(masterAddr util.Address, path util.DFSPath) error {
+	pc.mu.Lock()
+	p, ok := pc.pages[path]
+	if !ok || len(p.buf) == 0 {
+		pc.mu.Unlock()
+		return nil
+	}
+	buf, off := p.buf, p.off
+	delete(pc.pages, path)
+	pc.mu.Unlock()
+
+	chunkIdx := off / pc.chunkSize
+
+	var replicas util.GetReplicasRet
+	getArgs := util.GetReplicasArg{Path: path, ChunkIndex: chunkIdx}
+	if err := util.Call(string(masterAddr), "Master.GetReplicasRPC", getArgs, &replicas); err != nil {
+		return err
+	}
+	if len(replicas.ChunkServerAddrs) == 0 {
+		return nil
+	}
+
+	loadArgs := util.LoadDataArgs{
+		Data:  buf,
+		CID:   util.CacheID{Handle: replicas.ChunkHandle},
+		Addrs: replicas.ChunkServerAddrs[1:],
+	}
+	var loadReply util.LoadDataReply
+	return util.Call(string(replicas.ChunkServerAddrs[0]), "ChunkServer.LoadDataRPC", loadArgs, &loadReply)
+}
+
+// flushAll uploads content in full, chunkSize-aligned pieces via LoadDataRPC
+// fan-out to every replica, in chunk order, regardless of what's staged.
+func (pc *pageCache) flushAll(masterAddr util.Address, path util.DFSPath, content string) error {
+	data := []byte(content)
+	for chunkIdx := 0; int64(chunkIdx)*pc.chunkSize < int64(len(data)); chunkIdx++ {
+		start := int64(chunkIdx) * pc.chunkSize
+		end := start + pc.chunkSize
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+
+		var replicas util.GetReplicasRet
+		getArgs := util.GetReplicasArg{Path: path, ChunkIndex: int64(chunkIdx)}
+		if err := util.Call(string(masterAddr), "Master.GetReplicasRPC", getArgs, &replicas); err != nil {
+			return err
+		}
+		if len(replicas.ChunkServerAddrs) == 0 {
+			continue
+		}
+
+		loadArgs := util.LoadDataArgs{
+			Data:  data[start:end],
+			CID:   util.CacheID{Handle: replicas.ChunkHandle},
+			Addrs: replicas.ChunkServerAddrs[1:],
+		}
+		var loadReply util.LoadDataReply
+		if err := util.Call(string(replicas.ChunkServerAddrs[0]), "ChunkServer.LoadDataRPC", loadArgs, &loadReply); err != nil {
+			return err
+		}
+	}
+
+	pc.mu.Lock()
+	delete(pc.pages, path)
+	pc.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,138 @@
+package fuse
+
+import (
+	"DFS/util"
+	"sync"
+)
+
+// prefetcher detects sequential Read access per path and pipelines the next
+// chunk's ReadChunkRPC ahead of the caller asking for it, so sequential scans
+// (e.g. a tool streaming a whole sheet checkpoint) don't pay a round trip per
+// chunk.
+type prefetcher struct {
+	masterAddr util.Address
+
+	mu      sync.Mutex
+	streams map[util.DFSPath]*readStream
+}
+
+type readStream struct {
+	lastEnd int64
+	ahead   map[int64][]byte // chunkIndex -> prefetched bytes, recorded once the fetch completes
+}
+
+func newPrefetcher(masterAddr util.Address) *prefetcher {
+	return &prefetcher{masterAddr: masterAddr, streams: make(map[util.DFSPath]*readStream)}
+}
+
+func (pf *prefetcher) forget(path util.DFSPath) {
+	pf.mu.Lock()
+	delete(pf.streams, path)
+	pf.mu.Unlock()
+}
+
+// read serves [off, off+size) for path, reading the owning chunk directly and,
+// if this request continues a sequential stream, kicking off a background
+// fetch of the following chunk.
+func (pf *prefetcher) read(masterAddr util.Address, path util.DFSPath, off int64, size int) ([]byte, error) {
+	chunkIdx := off / util.MAXCHUNKSIZE
+	chunkOff := int(off % util.MAXCHUNKSIZE)
+
+	pf.mu.Lock()
+	stream, ok := pf.streams[path]
+	if !ok {
+		stream = &readStream{ahead: make(map[int64][]byte)}
+		pf.streams[path] = stream
+	}
+	sequential := stream.lastEnd == off
+	cached, isCached := stream.ahead[chunkIdx]
+	stream.lastEnd = off + int64(size)
+	pf.mu.Unlock()
+
+	var buf []byte
+	var err error
+	if isCached {
+		buf = cached
+	} else {
+		buf, err = pf.fetchChunk(masterAddr, path, chunkIdx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if sequential {
+		go pf.prefetchChunk(masterAddr, path, chunkIdx+1)
+	}
+
+	end := chunkOff + size
+	if end > len(buf) {
+		end = len(buf)
+	}
+	if chunkOff > end {
+		return nil, nil
+	}
+	return buf[chunkOff:end], nil
+}
+
+func (pf *prefetcher) prefetchChunk(masterAddr util.Address, path util.DFSPath, chunkIdx int64) {
+	pf.mu.Lock()
+	stream, ok := pf.streams[path]
+	if !ok {
+		pf.mu.Unlock()
+		return
+	}
+	if _, already := stream.ahead[chunkIdx]; already {
+		pf.mu.Unlock()
+		return
+	}
+	pf.mu.Unlock()
+
+	buf, err := pf.fetchChunk(masterAddr, path, chunkIdx)
+	if err != nil {
+		return
+	}
+
+	pf.mu.Lock()
+	if stream, ok := pf.streams[path]; ok {
+		stream.ahead[chunkIdx] = buf
+	}
+	pf.mu.Unlock()
+}
+
+func (pf *prefetcher) fetchChunk(masterAddr util.Address, path util.DFSPath, chunkIdx int64) ([]byte, error) {
+	var meta util.GetFileMetaRet
+	if err := util.Call(string(masterAddr), "Master.GetFileMetaRPC", util.GetFileMetaArg{Path: path}, &meta); err != nil {
+		return nil, err
+	}
+
+	chunkLen := int64(util.MAXCHUNKSIZE)
+	if remaining := int64(meta.Size) - chunkIdx*util.MAXCHUNKSIZE; remaining < chunkLen {
+		chunkLen = remaining
+	}
+	if chunkLen <= 0 {
+		return nil, nil
+	}
+
+	var replicas util.GetReplicasRet
+	getArgs := util.GetReplicasArg{Path: path, ChunkIndex: chunkIdx}
+	if err := util.Call(string(masterAddr), "Master.GetReplicasRPC", getArgs, &replicas); err != nil {
+		return nil, err
+	}
+	if len(replicas.ChunkServerAddrs) == 0 {
+		return nil, nil
+	}
+
+	readArgs := util.ReadChunkArgs{
+		Handle:     replicas.ChunkHandle,
+		Off:        0,
+		Len:        int(chunkLen),
+		Encoding:   replicas.Encoding,
+		EC:         replicas.EC,
+		ShardAddrs: replicas.ShardAddrs,
+	}
+	var reply util.ReadChunkReply
+	if err := util.Call(string(replicas.ChunkServerAddrs[0]), "ChunkServer.ReadChunkRPC", readArgs, &reply); err != nil {
+		return nil, err
+	}
+	return reply.Buf[:reply.Len], nil
+}
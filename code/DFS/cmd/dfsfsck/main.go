@@ -0,0 +1,64 @@
+// Command dfsfsck is the dfs.fsck subcommand: it diffs the chunks
+// chunkservers actually hold on disk against the chunks the master namespace
+// expects to exist, reporting (and optionally deleting) orphan chunks and
+// reporting chunks that need re-replication.
+package main
+
+import (
+	"DFS/fsck"
+	"DFS/util"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+)
+
+func main() {
+	master := flag.String("master", "", "address of the DFS master, e.g. 127.0.0.1:7777")
+	chunkServerList := flag.String("chunkservers", "", "comma-separated chunkserver addresses")
+	root := flag.String("root", "/", "namespace subtree to check")
+	verbose := flag.Bool("verbose", false, "print every orphan/missing handle, not just the counts")
+	dryRun := flag.Bool("dryRun", true, "report only, don't delete orphan chunks")
+	findMissingInMaster := flag.Bool("findMissingChunksInMaster", false, "also report chunks the namespace expects but no chunkserver has")
+	flag.Parse()
+
+	if *master == "" || *chunkServerList == "" {
+		log.Fatalf("usage: dfsfsck -master=host:port -chunkservers=host:port,... [-root=/path] [-verbose] [-dryRun] [-findMissingChunksInMaster]")
+	}
+	if !*dryRun && *root != "/" {
+		log.Fatalf("dfsfsck: -dryRun=false needs -root=/: a subtree check reports chunks of files outside it as orphans")
+	}
+
+	var chunkServers []util.Address
+	for _, addr := range strings.Split(*chunkServerList, ",") {
+		chunkServers = append(chunkServers, util.Address(addr))
+	}
+
+	report, err := fsck.Check(util.Address(*master), chunkServers, util.DFSPath(*root))
+	if err != nil {
+		log.Fatalf("dfsfsck: %v", err)
+	}
+
+	fmt.Printf("orphan chunks: %d\n", len(report.Orphans))
+	if *verbose {
+		for _, handle := range report.Orphans {
+			fmt.Printf("  orphan: %d\n", handle)
+		}
+	}
+
+	if *findMissingInMaster {
+		fmt.Printf("missing chunks: %d\n", len(report.Missing))
+		if *verbose {
+			for _, handle := range report.Missing {
+				fmt.Printf("  missing: %d\n", handle)
+			}
+		}
+	}
+
+	if !*dryRun && len(report.Orphans) > 0 {
+		if err := fsck.DeleteOrphans(chunkServers, report.Orphans); err != nil {
+			log.Fatalf("dfsfsck: failed deleting orphans: %v", err)
+		}
+		fmt.Printf("deleted %d orphan chunks\n", len(report.Orphans))
+	}
+}
@@ -0,0 +1,42 @@
+// Command dfsmount mounts a DFS namespace at a local path as a POSIX
+// filesystem, so that tools which don't speak the backend/dao API can read
+// and write DFS files directly.
+package main
+
+import (
+	"DFS/client/fuse"
+	"DFS/util"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	master := flag.String("master", "", "address of the DFS master, e.g. 127.0.0.1:7777")
+	readOnly := flag.Bool("read-only", false, "mount the namespace read-only")
+	chunkSize := flag.Int64("chunk-size", util.MAXCHUNKSIZE, "chunk size in bytes used for write batching (read-ahead always uses util.MAXCHUNKSIZE)")
+	replicas := flag.Int("replicas", 3, "replica count recorded in the mount options (not passed to the master on create)")
+	flag.Parse()
+
+	if *master == "" || flag.NArg() != 1 {
+		log.Fatalf("usage: dfsmount -master=host:port [-read-only] [-chunk-size=N] [-replicas=N] <mountpoint>")
+	}
+	mountPoint := flag.Arg(0)
+
+	conn, err := fuse.Mount(mountPoint, fuse.Options{
+		MasterAddr: util.Address(*master),
+		ReadOnly:   *readOnly,
+		ChunkSize:  *chunkSize,
+		ReplicaNum: *replicas,
+	})
+	if err != nil {
+		log.Fatalf("dfsmount: mount %v failed: %v", mountPoint, err)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	<-sig
+
+	conn.Close()
+}
@@ -0,0 +1,108 @@
+// Package fsck implements dfs.fsck, a consistency checker modeled on
+// SeaweedFS's volume.fsck: it diffs the chunk handles chunkservers actually
+// hold on disk against the handles reachable from the master namespace, to
+// find orphan chunks (left behind by crashed writes or partial
+// CreateChunkRPC calls) and chunks the namespace expects but no chunkserver
+// has (needing re-replication).
+package fsck
+
+import (
+	"DFS/util"
+	"fmt"
+)
+
+// Report is the result of a single Check run.
+type Report struct {
+	Orphans []util.Handle // present on a chunkserver, unreachable from Check's root (A \ B); with a root other than "/" this includes chunks of files outside it
+	Missing []util.Handle // reachable from the namespace, absent from every chunkserver (B \ A)
+}
+
+// Check walks every address in chunkServers via ListChunksRPC to build set A,
+// and walks the master namespace under root via ListReachableHandlesRPC to
+// build set B, then returns their set difference in both directions.
+func Check(masterAddr util.Address, chunkServers []util.Address, root util.DFSPath) (Report, error) {
+	present := make(map[util.Handle]util.Address)
+	for _, addr := range chunkServers {
+		var ret util.ListChunksRet
+		if err := util.Call(string(addr), "ChunkServer.ListChunksRPC", util.ListChunksArgs{}, &ret); err != nil {
+			return Report{}, fmt.Errorf("fsck: ListChunksRPC on %s failed: %w", addr, err)
+		}
+		for _, handle := range ret.Handles {
+			present[handle] = addr
+		}
+	}
+
+	var reachableRet util.ListReachableHandlesRet
+	reachableArgs := util.ListReachableHandlesArgs{Root: root}
+	if err := util.Call(string(masterAddr), "Master.ListReachableHandlesRPC", reachableArgs, &reachableRet); err != nil {
+		return Report{}, fmt.Errorf("fsck: ListReachableHandlesRPC failed: %w", err)
+	}
+	reachable := make(map[util.Handle]bool, len(reachableRet.Handles))
+	for _, handle := range reachableRet.Handles {
+		reachable[handle] = true
+	}
+
+	var report Report
+	for handle := range present {
+		if !reachable[handle] {
+			report.Orphans = append(report.Orphans, handle)
+		}
+	}
+	for handle := range reachable {
+		if _, ok := present[handle]; !ok {
+			report.Missing = append(report.Missing, handle)
+		}
+	}
+
+	return report, nil
+}
+
+// DeleteOrphans asks the chunkserver owning each orphan handle to remove its
+// on-disk chunk. It is a no-op for handles Check() did not report as orphans.
+func DeleteOrphans(chunkServers []util.Address, orphans []util.Handle) error {
+	orphanSet := make(map[util.Handle]bool, len(orphans))
+	for _, handle := range orphans {
+		orphanSet[handle] = true
+	}
+
+	for _, addr := range chunkServers {
+		var ret util.ListChunksRet
+		if err := util.Call(string(addr), "ChunkServer.ListChunksRPC", util.ListChunksArgs{}, &ret); err != nil {
+			return err
+		}
+		for _, handle := range ret.Handles {
+			if !orphanSet[handle] {
+				continue
+			}
+			var deleteReply util.DeleteChunkReply
+			deleteArgs := util.DeleteChunkArgs{Handle: handle}
+			if err := util.Call(string(addr), "ChunkServer.DeleteChunkRPC", deleteArgs, &deleteReply); err != nil {
+				return fmt.Errorf("fsck: failed deleting orphan chunk %d on %s: %w", handle, addr, err)
+			}
+		}
+	}
+	return nil
+}
+
+// RepairPath runs a targeted Check scoped to a single subtree, without the caller having to run
+// a full-namespace fsck. It's used by dao.RepairMissingChunks when a sheet log/checkpoint
+// references a DFS file whose chunk turns out to be gone, to find out whether that's actually
+// true or just a transient RPC failure.
+//
+// dfs.fsck has no mechanism to conjure back a chunk with zero surviving copies anywhere -- that
+// needs a live replica or erasure-coded shard to rebuild from, which Check alone can't tell it
+// (see chunkserver.ReconstructShardRPC for the shard-level repair path that actually can, used
+// once a caller knows a handle's erasure-coding layout). So RepairPath's job is strictly to
+// confirm or deny: if nothing is missing, the earlier failure this is repairing was transient and
+// the caller should just retry its read; if something genuinely has no surviving copy, that's
+// reported as an error rather than silently pretended away.
+func RepairPath(masterAddr util.Address, chunkServers []util.Address, path util.DFSPath) error {
+	report, err := Check(masterAddr, chunkServers, path)
+	if err != nil {
+		return err
+	}
+	if len(report.Missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("fsck: %d chunk(s) under %s have no surviving copy on any chunkserver: %v", len(report.Missing), path, report.Missing)
+}
@@ -10,6 +10,21 @@ type Address string
 
 // Client
 
+// Encoding selects how a chunk's data is stored across chunkservers.
+type Encoding int
+
+const (
+	Replicated Encoding = iota
+	ErasureCoded
+)
+
+// ECParams describes a Reed-Solomon layout: k data shards + m parity shards.
+// Only meaningful when the owning chunk's Encoding is ErasureCoded.
+type ECParams struct {
+	K int
+	M int
+}
+
 // RPC structure
 type CreateArg struct {
 	Path DFSPath
@@ -39,6 +54,9 @@ type GetReplicasArg struct {
 type GetReplicasRet struct {
 	ChunkHandle      Handle
 	ChunkServerAddrs []Address
+	Encoding         Encoding
+	EC               ECParams  // valid when Encoding == ErasureCoded
+	ShardAddrs       []Address // valid when Encoding == ErasureCoded, len == EC.K+EC.M, indexed by shard number
 }
 
 const (
@@ -32,16 +32,105 @@ type SyncReply struct {
 }
 
 type CreateChunkArgs struct {
-	Handle Handle
+	Handle   Handle
+	Encoding Encoding
+	EC       ECParams // valid when Encoding == ErasureCoded
+
+	// ShardAddrs is where each of EC.K+EC.M shards should eventually live once this chunk goes
+	// read-only and the primary's background erasure-coding job (chunkserver.EncodeChunkToShards)
+	// picks it up. Valid, and required to have len == EC.K+EC.M, when Encoding == ErasureCoded.
+	ShardAddrs []Address
 }
 
 type CreateChunkReply struct {
 }
 
+type DeleteChunkArgs struct {
+	Handle Handle
+}
+
+type DeleteChunkReply struct {
+}
+
+// MarkReadOnlyArgs asks a chunk's primary to register it for the background erasure-coding job
+// (chunkserver.EncodeChunkToShards), the same registration CreateChunkRPC does up front for a
+// chunk created with Encoding == ErasureCoded -- used instead when a chunk was created as an
+// ordinary replicated chunk and only later becomes read-only (e.g. a sheet checkpoint, which is
+// written once by sheetCreatePickledCheckPointInDfs and never modified again).
+type MarkReadOnlyArgs struct {
+	Handle     Handle
+	EC         ECParams
+	ShardAddrs []Address // len must be EC.K+EC.M
+}
+
+type MarkReadOnlyReply struct {
+}
+
+// StoreShardArgs stores a single erasure-coded shard (data or parity) for a chunk.
+// ShardIdx is in [0, EC.K+EC.M), with [0, EC.K) being data shards and the rest parity.
+type StoreShardArgs struct {
+	Handle   Handle
+	ShardIdx int
+	EC       ECParams
+	Data     []byte
+}
+
+type StoreShardReply struct {
+}
+
+// ReconstructShardArgs asks a chunkserver to rebuild a single missing shard onto itself
+// by pulling any K surviving shards from SourceAddrs, without materializing the whole chunk.
+type ReconstructShardArgs struct {
+	Handle      Handle
+	ShardIdx    int
+	EC          ECParams
+	SourceAddrs []Address // chunkservers holding surviving shards, indexed by shard number
+}
+
+type ReconstructShardReply struct {
+}
+
+// ListChunksArgs/Ret backs dfs.fsck's set-A collection: every chunk (and
+// shard) handle a chunkserver actually has on disk.
+type ListChunksArgs struct {
+}
+
+type ListChunksRet struct {
+	Handles []Handle
+}
+
+// ListReachableHandlesArgs/Ret backs dfs.fsck's set-B collection: every chunk
+// handle reachable from a live file under Root in the master namespace.
+type ListReachableHandlesArgs struct {
+	Root DFSPath
+}
+
+type ListReachableHandlesRet struct {
+	Handles []Handle
+}
+
+// SnapshotArgs/Reply backs dfs.Snapshot: the master clones the inode at SrcPath to DstPath and
+// bumps the refcount on every chunk handle reachable from it, instead of physically copying
+// chunk data. A chunk is only ever handed to ChunkServer.DeleteChunkRPC once its refcount drops
+// to zero.
+type SnapshotArgs struct {
+	SrcPath DFSPath
+	DstPath DFSPath
+}
+
+type SnapshotReply struct {
+}
+
 type ReadChunkArgs struct {
 	Handle Handle
 	Off    int
 	Len    int
+
+	// Populated by the client when the chunk's master-reported Encoding is ErasureCoded,
+	// so the chunkserver can reconstruct the chunk if its own full replica is gone.
+	Encoding   Encoding
+	EC         ECParams
+	ShardAddrs []Address
 }
 type ReadChunkReply struct {
 	Len int
@@ -77,13 +166,15 @@ type GetReplicasArg struct {
 type GetReplicasRet struct {
 	ChunkHandle      Handle
 	ChunkServerAddrs []Address
+	Encoding         Encoding
+	EC               ECParams  // valid when Encoding == ErasureCoded
+	ShardAddrs       []Address // valid when Encoding == ErasureCoded, len == EC.K+EC.M, indexed by shard number
 }
 type GetFileMetaArg struct {
-	Path       DFSPath
+	Path DFSPath
 }
-type GetFileMetaRet struct{
+type GetFileMetaRet struct {
 	Exist bool
 	IsDir bool
-	Size int32
+	Size  int32
 }
-